@@ -0,0 +1,104 @@
+// adbctl is a thin client for adbfs-manager: it dials the daemon's Unix
+// socket rather than mounting anything itself.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zach-klippenstein/adbfs/fusemanager"
+)
+
+var socketPath = flag.String("socket", filepath.Join(os.TempDir(), "adbfs-manager.sock"),
+	"path to the adbfs-manager Unix socket")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	client := fusemanager.NewClient(*socketPath)
+
+	var err error
+	switch args[0] {
+	case "mount":
+		err = runMount(client, args[1:])
+	case "unmount":
+		err = runUnmount(client, args[1:])
+	case "list":
+		err = runList(client)
+	case "status":
+		err = runStatus(client, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "adbctl:", err)
+		os.Exit(1)
+	}
+}
+
+func runMount(client *fusemanager.Client, args []string) error {
+	set := flag.NewFlagSet("mount", flag.ExitOnError)
+	readOnly := set.Bool("read-only", false, "mount read-only")
+	allowOther := set.Bool("allow-other", false, "allow other users to access the mount")
+	volumeName := set.String("volume-name", "", "volume name shown by the OS")
+	set.Parse(args)
+
+	if set.NArg() != 2 {
+		return fmt.Errorf("usage: adbctl mount [flags] <serial> <mountpoint>")
+	}
+
+	return client.Mount(set.Arg(0), set.Arg(1), fusemanager.MountOpts{
+		ReadOnly:   *readOnly,
+		AllowOther: *allowOther,
+		VolumeName: *volumeName,
+	})
+}
+
+func runUnmount(client *fusemanager.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: adbctl unmount <serial>")
+	}
+	return client.Unmount(args[0])
+}
+
+func runList(client *fusemanager.Client) error {
+	infos, err := client.List()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		fmt.Printf("%s\t%s\n", info.Serial, info.Mountpoint)
+	}
+	return nil
+}
+
+func runStatus(client *fusemanager.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: adbctl status <serial>")
+	}
+
+	info, err := client.Status(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\t%s\n", info.Serial, info.Mountpoint)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: adbctl [flags] <mount|unmount|list|status> ...")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,74 @@
+// adbfs-manager is a daemon that owns every FUSE mount for an adb server;
+// clients dial its Unix socket to mount, unmount, list, and query devices.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/zach-klippenstein/adbfs/fusemanager"
+	"github.com/zach-klippenstein/goadb"
+)
+
+var (
+	socketPath         = flag.String("socket", defaultSocketPath(), "path to the Unix socket to serve the RPC API on")
+	registryPath       = flag.String("registry", defaultRegistryPath(), "path to the file used to persist the mount registry")
+	adbHost            = flag.String("adb-host", "localhost", "adb server host")
+	adbPort            = flag.Int("adb-port", 5037, "adb server port")
+	connectionPoolSize = flag.Int("connection-pool-size", 2, "number of connections to the adb server per mounted device")
+	cacheTtl           = flag.Duration("cache-ttl", 0, "how long to cache stat results for, 0 to disable caching")
+	shutdownTimeout    = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for a clean unmount per device on shutdown before forcing it")
+	verbose            = flag.Bool("v", false, "log debug output")
+)
+
+func defaultSocketPath() string {
+	return filepath.Join(os.TempDir(), "adbfs-manager.sock")
+}
+
+func defaultRegistryPath() string {
+	return filepath.Join(os.TempDir(), "adbfs-manager-registry.json")
+}
+
+func main() {
+	flag.Parse()
+
+	log := logrus.New()
+	if *verbose {
+		log.Level = logrus.DebugLevel
+	}
+
+	manager, err := fusemanager.NewManager(fusemanager.Options{
+		ClientConfig: goadb.ClientConfig{
+			Host: *adbHost,
+			Port: *adbPort,
+		},
+		ConnectionPoolSize: *connectionPoolSize,
+		CacheTtl:           *cacheTtl,
+		RegistryPath:       *registryPath,
+		ShutdownTimeout:    *shutdownTimeout,
+		Log:                log,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go func() {
+		log.Println("serving RPC API on", *socketPath)
+		if err := fusemanager.Serve(manager, *socketPath); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	log.Println("shutting down, unmounting all devices...")
+	manager.Close()
+	time.Sleep(100 * time.Millisecond)
+}
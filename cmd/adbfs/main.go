@@ -9,14 +9,19 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -29,15 +34,39 @@ import (
 
 const StartTimeout = 5 * time.Second
 
+// errReconnectWindowElapsed signals giving up and unmounting; not logged as an error.
+var errReconnectWindowElapsed = errors.New("reconnect window elapsed")
+
 var (
 	config cli.AdbfsConfig
 
-	server *fuse.Server
+	reconnectWindow = flag.Duration("reconnect-window", 30*time.Second,
+		"if the mounted device disconnects, wait up to this long for it to come back online before giving up and exiting")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second,
+		"how long to wait for a clean unmount on shutdown before forcing it")
 
 	mounted fs.AtomicBool
 
 	// Prevents trying to unmount the server multiple times.
 	unmounted fs.AtomicBool
+
+	cache              fs.DirEntryCache
+	clientConfig       goadb.ClientConfig
+	absoluteMountpoint string
+
+	// deviceWatcher is created once in main and reused across remounts, so a
+	// flapping device doesn't leak a watcher per reconnect cycle.
+	deviceWatcher *goadb.DeviceWatcher
+
+	// mu guards server, serverDone, and the remount bookkeeping below, since
+	// handleDeviceDisconnected can run concurrently with main's select loop
+	// and with a signal-triggered shutdown.
+	mu          sync.Mutex
+	server      *fuse.Server
+	serverDone  chan struct{}
+	remounting  bool
+	remountDone chan struct{}
 )
 
 func init() {
@@ -54,7 +83,8 @@ func main() {
 	if config.Mountpoint == "" {
 		cli.Log.Fatalln("Mountpoint must be specified. Run with -h.")
 	}
-	absoluteMountpoint, err := filepath.Abs(config.Mountpoint)
+	var err error
+	absoluteMountpoint, err = filepath.Abs(config.Mountpoint)
 	if err != nil {
 		cli.Log.Fatal(err)
 	}
@@ -64,44 +94,160 @@ func main() {
 
 	initializeProfiler()
 
-	cache := initializeCache(config.CacheTtl)
-	clientConfig := config.ClientConfig()
+	cache = initializeCache(config.CacheTtl)
+	clientConfig = config.ClientConfig()
+	deviceWatcher = goadb.NewDeviceWatcher(clientConfig)
 
-	fs := initializeFileSystem(clientConfig, absoluteMountpoint, cache, handleDeviceDisconnected)
-
-	server, _, err = nodefs.MountRoot(absoluteMountpoint, fs.Root(), nil)
-	if err != nil {
-		cli.Log.Fatal(err)
-	}
-
-	serverDone, err := startServer(StartTimeout)
-	if err != nil {
+	if err := mountAndServe(absoluteMountpoint); err != nil {
 		cli.Log.Fatal(err)
 	}
 	cli.Log.Printf("mounted %s on %s", config.DeviceSerial, absoluteMountpoint)
 	mounted.CompareAndSwap(false, true)
-	defer unmountServer()
+	defer shutdown()
 
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, os.Kill)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	shuttingDown := false
 
 	for {
 		select {
 		case signal := <-signals:
-			cli.Log.Println("got signal", signal)
-			switch signal {
-			case os.Kill, os.Interrupt:
-				cli.Log.Println("exiting...")
-				return
+			if shuttingDown {
+				cli.Log.Println("got second signal", signal, "- exiting immediately")
+				os.Exit(1)
+			}
+
+			cli.Log.Println("got signal", signal, "- shutting down...")
+			shuttingDown = true
+			go func() {
+				shutdown()
+				os.Exit(0)
+			}()
+
+		case <-currentServerDone():
+			mu.Lock()
+			if remounting {
+				rd := remountDone
+				mu.Unlock()
+				// Wait for the in-progress remount attempt to finish before
+				// deciding whether the server is really gone.
+				<-rd
+				continue
 			}
+			mu.Unlock()
 
-		case <-serverDone:
 			cli.Log.Debugln("server done channel closed.")
 			return
 		}
 	}
 }
 
+// mountAndServe mounts and serves a fresh AdbFileSystem against mountpoint.
+// Used for both the initial mount and remounting after a reconnect.
+func mountAndServe(mountpoint string) error {
+	newFs := initializeFileSystem(clientConfig, mountpoint, cache, handleDeviceDisconnected)
+
+	// nodefs.MountRoot hardcodes its own &fuse.MountOptions{} and doesn't take
+	// one from its caller, so build the connector and server ourselves to get
+	// our mount options applied.
+	conn := nodefs.NewFileSystemConnector(newFs.Root(), nil)
+	newServer, err := fuse.NewServer(conn.RawFS(), mountpoint, mountOptions())
+	if err != nil {
+		return err
+	}
+
+	done, err := startServer(newServer, StartTimeout)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	server = newServer
+	serverDone = done
+	mu.Unlock()
+
+	return nil
+}
+
+func currentServerDone() <-chan struct{} {
+	mu.Lock()
+	defer mu.Unlock()
+	return serverDone
+}
+
+// shutdown unmounts cleanly, falling back to a forced unmount after *shutdownTimeout.
+func shutdown() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		unmountServer()
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(*shutdownTimeout):
+		cli.Log.Warnln("clean unmount did not finish within", *shutdownTimeout, "- forcing it...")
+		forceUnmount(absoluteMountpoint)
+	}
+}
+
+// forceUnmount lazily unmounts mountpoint using whatever the host OS provides.
+func forceUnmount(mountpoint string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("fusermount", "-u", "-z", mountpoint)
+	case "darwin":
+		cmd = exec.Command("diskutil", "unmount", "force", mountpoint)
+	default:
+		cli.Log.Warnln("don't know how to force-unmount on", runtime.GOOS)
+		return
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		cli.Log.Errorln("error forcing unmount:", err, string(out))
+	}
+}
+
+// mountOptions translates config's FUSE mount flags into a fuse.MountOptions,
+// passing fields with no direct equivalent through as raw "-o" options.
+func mountOptions() *fuse.MountOptions {
+	var raw []string
+	if config.ReadOnly {
+		raw = append(raw, "ro")
+	}
+	if config.AllowRoot {
+		raw = append(raw, "allow_root")
+	}
+	if config.DefaultPermissions {
+		raw = append(raw, "default_permissions")
+	}
+	if config.VolumeName != "" {
+		raw = append(raw, "volname="+config.VolumeName)
+	}
+	if config.MaxReadahead > 0 {
+		raw = append(raw, fmt.Sprintf("max_readahead=%d", config.MaxReadahead))
+	}
+	if config.WritebackCache {
+		raw = append(raw, "writeback_cache")
+	}
+	if config.NoAppleDouble {
+		raw = append(raw, "noappledouble")
+	}
+	if config.NoAppleXattr {
+		raw = append(raw, "noapplexattr")
+	}
+
+	return &fuse.MountOptions{
+		AllowOther: config.AllowOther,
+		FsName:     config.FSName,
+		Name:       config.Subtype,
+		Options:    raw,
+	}
+}
+
 func initializeProfiler() {
 	if !config.ServeDebug {
 		return
@@ -161,7 +307,6 @@ func initializeCache(ttl time.Duration) fs.DirEntryCache {
 func initializeFileSystem(clientConfig goadb.ClientConfig, mountpoint string, cache fs.DirEntryCache, deviceNotFoundHandler func()) *pathfs.PathNodeFs {
 	clientFactory := fs.NewCachingDeviceClientFactory(cache,
 		fs.NewGoadbDeviceClientFactory(clientConfig, config.DeviceSerial))
-	deviceWatcher := goadb.NewDeviceWatcher(clientConfig)
 
 	var fsImpl pathfs.FileSystem
 	fsImpl, err := fs.NewAdbFileSystem(fs.Config{
@@ -177,14 +322,20 @@ func initializeFileSystem(clientConfig goadb.ClientConfig, mountpoint string, ca
 		cli.Log.Fatal(err)
 	}
 
+	if config.ReadOnly {
+		// Short-circuits write ops with EROFS instead of letting them reach
+		// (and fail against, or worse succeed against) the device.
+		fsImpl = pathfs.NewReadonlyFileSystem(fsImpl)
+	}
+
 	return pathfs.NewPathNodeFs(fsImpl, nil)
 }
 
-func startServer(startTimeout time.Duration) (<-chan struct{}, error) {
+func startServer(s *fuse.Server, startTimeout time.Duration) (<-chan struct{}, error) {
 	serverDone := make(chan struct{})
 	go func() {
 		defer close(serverDone)
-		server.Serve()
+		s.Serve()
 		cli.Log.Println("server finished.")
 		return
 	}()
@@ -195,7 +346,7 @@ func startServer(startTimeout time.Duration) (<-chan struct{}, error) {
 	serverReady := make(chan struct{})
 	go func() {
 		defer close(serverReady)
-		server.WaitMount()
+		s.WaitMount()
 	}()
 
 	select {
@@ -210,7 +361,11 @@ func startServer(startTimeout time.Duration) (<-chan struct{}, error) {
 }
 
 func unmountServer() {
-	if server == nil {
+	mu.Lock()
+	s := server
+	mu.Unlock()
+
+	if s == nil {
 		panic("attempted to unmount server before creating it")
 	}
 	if !mounted.Value() {
@@ -219,7 +374,7 @@ func unmountServer() {
 
 	if unmounted.CompareAndSwap(false, true) {
 		cli.Log.Println("unmounting...")
-		server.Unmount()
+		s.Unmount()
 		cli.Log.Println("unmounted.")
 	}
 }
@@ -230,8 +385,89 @@ func handleDeviceDisconnected() {
 		return
 	}
 
-	cli.Log.Infoln("device disconnected, unmounting...")
+	cli.Log.Infoln("device disconnected, waiting up to", *reconnectWindow, "for it to come back online...")
+
+	rd := make(chan struct{})
+	mu.Lock()
+	remounting = true
+	remountDone = rd
+	mu.Unlock()
+
+	var err error
+	if waitForDeviceReconnect(config.DeviceSerial, *reconnectWindow) {
+		cli.Log.Infoln("device reconnected, remounting...")
+		err = remount()
+		if err != nil {
+			cli.Log.Errorln("device reconnected but remount failed, mountpoint is now orphaned:", err)
+		}
+	} else {
+		cli.Log.Infoln("device did not reconnect within", *reconnectWindow, "giving up")
+		err = errReconnectWindowElapsed
+	}
+
+	mu.Lock()
+	remounting = false
+	mu.Unlock()
+	close(rd)
+
+	if err == errReconnectWindowElapsed {
+		unmountServer()
+	}
+	// If remount failed, it already tore down the stale server itself and
+	// left unmounted=true; there's nothing live left to unmount, so let
+	// serverDone's closure (from that teardown) propagate up and exit main's
+	// select loop instead of unmounting the stale handle a second time.
+}
+
+// remount tears down the stale server from a disconnect and rebuilds it
+// against absoluteMountpoint, clearing the dir entry cache first. On failure
+// unmounted is left true, since nothing live remains to unmount.
+func remount() error {
 	unmountServer()
+
+	cache.Clear()
+
+	if err := mountAndServe(absoluteMountpoint); err != nil {
+		return err
+	}
+
+	unmounted.CompareAndSwap(true, false)
+	return nil
+}
+
+// waitForDeviceReconnect polls for serial to come back online, backing off
+// between attempts, until it does or window elapses.
+func waitForDeviceReconnect(serial string, window time.Duration) bool {
+	deadline := time.Now().Add(window)
+	backoff := 250 * time.Millisecond
+
+	for time.Now().Before(deadline) {
+		if deviceIsOnline(serial) {
+			return true
+		}
+
+		time.Sleep(backoff)
+		if backoff < 2*time.Second {
+			backoff *= 2
+		}
+	}
+
+	return false
+}
+
+func deviceIsOnline(serial string) bool {
+	devices, err := goadb.NewHostClient(clientConfig).ListDevices()
+	if err != nil {
+		return false
+	}
+
+	for _, device := range devices {
+		if device.Serial == serial && device.State == goadb.StateOnline {
+			return true
+		}
+	}
+
+	return false
 }
 
 func checkValidMountpoint(path string) error {
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zach-klippenstein/adbfs/internal/cli"
+)
+
+func TestCheckValidMountpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adbfs_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, checkValidMountpoint(dir))
+
+	file, err := ioutil.TempFile(dir, "notadir")
+	assert.NoError(t, err)
+	file.Close()
+	assert.Error(t, checkValidMountpoint(file.Name()))
+
+	assert.Error(t, checkValidMountpoint(file.Name()+"-does-not-exist"))
+}
+
+func TestMountOptions(t *testing.T) {
+	config = cli.AdbfsConfig{}
+	config.ReadOnly = true
+	config.AllowRoot = true
+	config.FSName = "myfs"
+
+	opts := mountOptions()
+	assert.Equal(t, "myfs", opts.FsName)
+	assert.Contains(t, opts.Options, "ro")
+	assert.Contains(t, opts.Options, "allow_root")
+}
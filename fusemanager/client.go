@@ -0,0 +1,111 @@
+package fusemanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Client talks to a Manager's RPC API over its Unix socket. It's the thin
+// layer adbctl is built on.
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a Client that dials the Manager listening on socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Mount asks the daemon to mount serial at mountpoint with opts.
+func (c *Client) Mount(serial, mountpoint string, opts MountOpts) error {
+	body, err := json.Marshal(mountRequest{Serial: serial, Mountpoint: mountpoint, Opts: opts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post("http://unix/mount", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return responseError(resp)
+}
+
+// Unmount asks the daemon to unmount serial.
+func (c *Client) Unmount(serial string) error {
+	body, err := json.Marshal(unmountRequest{Serial: serial})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Post("http://unix/unmount", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return responseError(resp)
+}
+
+// List returns every mount the daemon currently owns.
+func (c *Client) List() ([]MountInfo, error) {
+	resp, err := c.httpClient.Get("http://unix/list")
+	if err != nil {
+		return nil, err
+	}
+	if err := responseError(resp); err != nil {
+		return nil, err
+	}
+
+	var infos []MountInfo
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// Status returns info about serial's mount, or an error if it isn't mounted.
+func (c *Client) Status(serial string) (MountInfo, error) {
+	resp, err := c.httpClient.Get("http://unix/status?serial=" + serial)
+	if err != nil {
+		return MountInfo{}, err
+	}
+	if err := responseError(resp); err != nil {
+		return MountInfo{}, err
+	}
+
+	var info MountInfo
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return MountInfo{}, err
+	}
+	return info, nil
+}
+
+// responseError returns nil (leaving resp.Body open for the caller to read)
+// on a 2xx response, or closes resp.Body and returns the server's error on
+// any other status.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+	return fmt.Errorf("request failed: %s", body.Error)
+}
@@ -0,0 +1,290 @@
+// Package fusemanager owns every FUSE mount for a single adb server from one
+// process, persisting a registry of active mounts so they survive restarts.
+//
+// cmd/adbfs does not dial this daemon; it mounts its device itself. Its
+// auto-remount-on-reconnect and most of its FUSE mount options are not
+// available here: Manager.Mount applies only read-only, allow_other and the
+// volume name, and a mount whose device disconnects is unmounted, not
+// remounted when the device comes back.
+package fusemanager
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+	fs "github.com/zach-klippenstein/adbfs"
+	"github.com/zach-klippenstein/goadb"
+)
+
+// Options configures a Manager. All mounts created by the Manager share the
+// same adb client config, cache TTL, and connection pool size.
+type Options struct {
+	ClientConfig       goadb.ClientConfig
+	CacheTtl           time.Duration
+	ConnectionPoolSize int
+	RegistryPath       string
+	ShutdownTimeout    time.Duration
+	Log                *logrus.Logger
+}
+
+// MountOpts are the per-mount FUSE options a caller can request through Mount.
+type MountOpts struct {
+	ReadOnly   bool
+	AllowOther bool
+	VolumeName string
+}
+
+// mount tracks a single active FUSE mount owned by the Manager.
+type mount struct {
+	Serial     string
+	Mountpoint string
+	Opts       MountOpts
+
+	server *fuse.Server
+	nodeFs *pathfs.PathNodeFs
+}
+
+// Manager owns all FUSE mounts for a single adb server. It is safe for
+// concurrent use.
+type Manager struct {
+	opts     Options
+	watcher  *goadb.DeviceWatcher
+	registry *registry
+
+	mu     sync.Mutex
+	mounts map[string]*mount // keyed by device serial
+}
+
+// NewManager creates a Manager, re-serving every mount recorded in the
+// registry at opts.RegistryPath. An unreachable device is logged and
+// skipped rather than failing startup.
+func NewManager(opts Options) (*Manager, error) {
+	reg, err := loadRegistry(opts.RegistryPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading mount registry: %s", err)
+	}
+
+	m := &Manager{
+		opts:     opts,
+		watcher:  goadb.NewDeviceWatcher(opts.ClientConfig),
+		registry: reg,
+		mounts:   make(map[string]*mount),
+	}
+
+	for _, info := range reg.snapshot() {
+		if err := m.Mount(info.Serial, info.Mountpoint, info.Opts); err != nil {
+			m.opts.Log.Errorln("error reclaiming mount for", info.Serial, "from registry:", err)
+		}
+	}
+
+	go m.watchDevices()
+
+	return m, nil
+}
+
+// watchDevices fans out disconnect events from the shared DeviceWatcher to
+// whichever mount owns the serial that changed state.
+func (m *Manager) watchDevices() {
+	for event := range m.watcher.C() {
+		if event.NewState != goadb.StateOnline {
+			m.handleDeviceDisconnected(event.Serial)
+		}
+	}
+}
+
+// handleDeviceDisconnected unmounts serial. It's registered as every mount's
+// DeviceNotFoundHandler and also invoked directly from watchDevices, so a
+// single disconnect can fire it twice; the ErrNotMounted that Unmount returns
+// on the second call is ignored here so it doesn't log spuriously.
+func (m *Manager) handleDeviceDisconnected(serial string) {
+	m.mu.Lock()
+	_, ok := m.mounts[serial]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	m.opts.Log.Infoln("device disconnected, unmounting:", serial)
+	if err := m.Unmount(serial); err != nil && err != ErrNotMounted {
+		m.opts.Log.Errorln("error unmounting", serial, "after disconnect:", err)
+	}
+}
+
+// ErrNotMounted is returned by Unmount and Status when serial isn't
+// currently mounted.
+var ErrNotMounted = errors.New("not mounted")
+
+// Mount mounts the device identified by serial at mountpoint, recording it in
+// the on-disk registry. It is a no-op error if the serial is already mounted.
+func (m *Manager) Mount(serial, mountpoint string, opts MountOpts) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mounts[serial]; ok {
+		return fmt.Errorf("%s is already mounted", serial)
+	}
+
+	cache := fs.NewDirEntryCache(m.opts.CacheTtl)
+	clientFactory := fs.NewCachingDeviceClientFactory(cache,
+		fs.NewGoadbDeviceClientFactory(m.opts.ClientConfig, serial))
+
+	fsImpl, err := fs.NewAdbFileSystem(fs.Config{
+		DeviceSerial:       serial,
+		Mountpoint:         mountpoint,
+		ClientFactory:      clientFactory,
+		Log:                m.opts.Log,
+		ConnectionPoolSize: m.opts.ConnectionPoolSize,
+		// m.watcher is drained solely by m.watchDevices, which dispatches to
+		// handleDeviceDisconnected by serial; a DeviceWatcher's channel only
+		// ever has one valid reader, so it can't also be handed to every
+		// mount's fs.Config without events getting stolen between mounts.
+		DeviceNotFoundHandler: func() { m.handleDeviceDisconnected(serial) },
+	})
+	if err != nil {
+		return fmt.Errorf("initializing filesystem for %s: %s", serial, err)
+	}
+
+	if opts.ReadOnly {
+		fsImpl = pathfs.NewReadonlyFileSystem(fsImpl)
+	}
+
+	var pathFsImpl pathfs.FileSystem = pathfs.NewPathNodeFs(fsImpl, nil)
+	nodeFs := pathFsImpl.(*pathfs.PathNodeFs)
+
+	// nodefs.MountRoot hardcodes its own empty fuse.MountOptions and ignores
+	// any options passed to it, so build the connector and server directly to
+	// get opts applied to the mount.
+	conn := nodefs.NewFileSystemConnector(nodeFs.Root(), nil)
+	server, err := fuse.NewServer(conn.RawFS(), mountpoint, &fuse.MountOptions{
+		AllowOther: opts.AllowOther,
+		Options:    volumeNameOption(opts.VolumeName),
+	})
+	if err != nil {
+		return fmt.Errorf("mounting %s on %s: %s", serial, mountpoint, err)
+	}
+	go server.Serve()
+
+	m.mounts[serial] = &mount{
+		Serial:     serial,
+		Mountpoint: mountpoint,
+		Opts:       opts,
+		server:     server,
+		nodeFs:     nodeFs,
+	}
+
+	return m.registry.put(MountInfo{Serial: serial, Mountpoint: mountpoint, Opts: opts})
+}
+
+func volumeNameOption(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return []string{"volname=" + name}
+}
+
+// Unmount unmounts the device identified by serial and removes it from the
+// registry.
+func (m *Manager) Unmount(serial string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mnt, ok := m.mounts[serial]
+	if !ok {
+		return ErrNotMounted
+	}
+
+	if err := mnt.server.Unmount(); err != nil {
+		return fmt.Errorf("unmounting %s: %s", serial, err)
+	}
+
+	delete(m.mounts, serial)
+	return m.registry.remove(serial)
+}
+
+// List returns info about every mount currently owned by the Manager.
+func (m *Manager) List() []MountInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	infos := make([]MountInfo, 0, len(m.mounts))
+	for _, mnt := range m.mounts {
+		infos = append(infos, MountInfo{Serial: mnt.Serial, Mountpoint: mnt.Mountpoint, Opts: mnt.Opts})
+	}
+	return infos
+}
+
+// Status returns info about the mount for serial, or an error if it isn't
+// currently mounted.
+func (m *Manager) Status(serial string) (MountInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mnt, ok := m.mounts[serial]
+	if !ok {
+		return MountInfo{}, ErrNotMounted
+	}
+	return MountInfo{Serial: mnt.Serial, Mountpoint: mnt.Mountpoint, Opts: mnt.Opts}, nil
+}
+
+// Close unmounts every mount owned by the Manager, forcing an unmount after
+// opts.ShutdownTimeout if a clean one doesn't finish in time. Errors are
+// logged but do not stop the rest from being unmounted.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	mounts := make([]*mount, 0, len(m.mounts))
+	for _, mnt := range m.mounts {
+		mounts = append(mounts, mnt)
+	}
+	m.mu.Unlock()
+
+	for _, mnt := range mounts {
+		m.closeMount(mnt)
+	}
+
+	return nil
+}
+
+// closeMount unmounts mnt, falling back to a forced unmount after
+// opts.ShutdownTimeout.
+func (m *Manager) closeMount(mnt *mount) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := m.Unmount(mnt.Serial); err != nil && err != ErrNotMounted {
+			m.opts.Log.Errorln("error unmounting", mnt.Serial, "during shutdown:", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(m.opts.ShutdownTimeout):
+		m.opts.Log.Warnln("clean unmount of", mnt.Serial, "did not finish within", m.opts.ShutdownTimeout, "- forcing it...")
+		forceUnmount(mnt.Mountpoint, m.opts.Log)
+	}
+}
+
+// forceUnmount lazily unmounts mountpoint using whatever the host OS provides.
+func forceUnmount(mountpoint string, log *logrus.Logger) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("fusermount", "-u", "-z", mountpoint)
+	case "darwin":
+		cmd = exec.Command("diskutil", "unmount", "force", mountpoint)
+	default:
+		log.Warnln("don't know how to force-unmount on", runtime.GOOS)
+		return
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Errorln("error forcing unmount:", err, string(out))
+	}
+}
@@ -0,0 +1,89 @@
+package fusemanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// MountInfo describes a single mount owned by a Manager, as persisted to the
+// on-disk registry and returned from List/Status.
+type MountInfo struct {
+	Serial     string    `json:"serial"`
+	Mountpoint string    `json:"mountpoint"`
+	Opts       MountOpts `json:"opts"`
+}
+
+// registry persists the set of active mounts to a JSON file on disk, keyed
+// by device serial, so the Manager can report what was mounted across
+// restarts.
+type registry struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]MountInfo
+}
+
+func loadRegistry(path string) (*registry, error) {
+	r := &registry{
+		path:    path,
+		entries: make(map[string]MountInfo),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return r, nil
+	}
+
+	if err := json.Unmarshal(data, &r.entries); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// snapshot returns the entries currently on disk, for NewManager to reclaim
+// on startup.
+func (r *registry) snapshot() []MountInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	infos := make([]MountInfo, 0, len(r.entries))
+	for _, info := range r.entries {
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (r *registry) put(info MountInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[info.Serial] = info
+	return r.saveLocked()
+}
+
+func (r *registry) remove(serial string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, serial)
+	return r.saveLocked()
+}
+
+// saveLocked writes the registry to disk. r.mu must be held.
+func (r *registry) saveLocked() error {
+	data, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0644)
+}
@@ -0,0 +1,53 @@
+package fusemanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRegistryMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	reg, err := loadRegistry(filepath.Join(dir, "registry.json"))
+	assert.NoError(t, err)
+	assert.Empty(t, reg.snapshot())
+}
+
+func TestRegistryPutRemoveSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	reg, err := loadRegistry(filepath.Join(dir, "registry.json"))
+	assert.NoError(t, err)
+
+	info := MountInfo{Serial: "abc123", Mountpoint: "/mnt/abc123", Opts: MountOpts{ReadOnly: true}}
+	assert.NoError(t, reg.put(info))
+	assert.Equal(t, []MountInfo{info}, reg.snapshot())
+
+	assert.NoError(t, reg.remove("abc123"))
+	assert.Empty(t, reg.snapshot())
+}
+
+func TestRegistryPersistsAcrossLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "registry.json")
+	reg, err := loadRegistry(path)
+	assert.NoError(t, err)
+
+	info := MountInfo{Serial: "abc123", Mountpoint: "/mnt/abc123"}
+	assert.NoError(t, reg.put(info))
+
+	reloaded, err := loadRegistry(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []MountInfo{info}, reloaded.snapshot())
+}
@@ -0,0 +1,103 @@
+package fusemanager
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+)
+
+// mountRequest is the JSON body of a POST /mount request.
+type mountRequest struct {
+	Serial     string    `json:"serial"`
+	Mountpoint string    `json:"mountpoint"`
+	Opts       MountOpts `json:"opts"`
+}
+
+// unmountRequest is the JSON body of a POST /unmount request.
+type unmountRequest struct {
+	Serial string `json:"serial"`
+}
+
+// errorResponse is returned, with a non-2xx status, when an RPC fails.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Serve starts an HTTP+JSON RPC server for m, listening on a Unix domain
+// socket at socketPath. It blocks until the listener is closed.
+//
+// Endpoints:
+//
+//	POST /mount    {"serial":..., "mountpoint":..., "opts":...}
+//	POST /unmount  {"serial":...}
+//	GET  /list     -> []MountInfo
+//	GET  /status?serial=... -> MountInfo
+func Serve(m *Manager, socketPath string) error {
+	if err := os.RemoveAll(socketPath); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mount", func(w http.ResponseWriter, req *http.Request) {
+		var body mountRequest
+		if !decodeRequest(w, req, &body) {
+			return
+		}
+		if err := m.Mount(body.Serial, body.Mountpoint, body.Opts); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/unmount", func(w http.ResponseWriter, req *http.Request) {
+		var body unmountRequest
+		if !decodeRequest(w, req, &body) {
+			return
+		}
+		if err := m.Unmount(body.Serial); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/list", func(w http.ResponseWriter, req *http.Request) {
+		writeJson(w, m.List())
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		serial := req.URL.Query().Get("serial")
+		info, err := m.Status(serial)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJson(w, info)
+	})
+
+	return http.Serve(listener, mux)
+}
+
+func decodeRequest(w http.ResponseWriter, req *http.Request, body interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
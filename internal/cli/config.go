@@ -0,0 +1,94 @@
+/*
+Package cli holds the flag definitions, configuration structs, and shared
+logger used by the adbfs command-line programs.
+*/
+package cli
+
+import (
+	"flag"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/zach-klippenstein/goadb"
+)
+
+// Log is the logger shared by every adbfs command. Initialize configures its
+// level from the parsed flags.
+var Log = logrus.New()
+
+// BaseConfig holds flags common to every adbfs command.
+type BaseConfig struct {
+	Verbose bool
+	AdbPort int
+}
+
+// RegisterBaseFlags registers the flags common to every adbfs command.
+func RegisterBaseFlags(config *BaseConfig) {
+	flag.BoolVar(&config.Verbose, "v", false, "print debug log messages")
+	flag.IntVar(&config.AdbPort, "adb-port", 5037, "adb server port")
+}
+
+// Initialize parses the registered flags and configures Log.
+func Initialize(appName string, config *BaseConfig) {
+	flag.Parse()
+
+	if config.Verbose {
+		Log.Level = logrus.DebugLevel
+	}
+}
+
+// AdbfsConfig holds the flags for the adbfs command.
+type AdbfsConfig struct {
+	BaseConfig
+
+	DeviceSerial string
+	Mountpoint   string
+
+	CacheTtl           time.Duration
+	ConnectionPoolSize int
+	ServeDebug         bool
+
+	// FUSE mount options. See RegisterAdbfsFlags for descriptions.
+	ReadOnly           bool
+	AllowOther         bool
+	AllowRoot          bool
+	DefaultPermissions bool
+	VolumeName         string
+	FSName             string
+	Subtype            string
+	MaxReadahead       int
+	WritebackCache     bool
+	NoAppleDouble      bool
+	NoAppleXattr       bool
+}
+
+// RegisterAdbfsFlags registers the flags for the adbfs command, storing their
+// values in config.
+func RegisterAdbfsFlags(config *AdbfsConfig) {
+	RegisterBaseFlags(&config.BaseConfig)
+
+	flag.StringVar(&config.DeviceSerial, "device", "", "serial number of the device to mount, as reported by adb devices")
+	flag.StringVar(&config.Mountpoint, "mountpoint", "", "directory to mount the device on")
+	flag.DurationVar(&config.CacheTtl, "cache-ttl", 0, "how long to cache stat results for, 0 to disable caching")
+	flag.IntVar(&config.ConnectionPoolSize, "connection-pool-size", 2, "number of connections to the adb server to keep open")
+	flag.BoolVar(&config.ServeDebug, "debug", false, "serve a pprof profiling endpoint")
+
+	flag.BoolVar(&config.ReadOnly, "read-only", false, "mount the device read-only, rejecting writes with EROFS")
+	flag.BoolVar(&config.AllowOther, "allow-other", false, "allow users other than the one running adbfs to access the mount")
+	flag.BoolVar(&config.AllowRoot, "allow-root", false, "allow root to access the mount")
+	flag.BoolVar(&config.DefaultPermissions, "default-permissions", false, "let the kernel enforce permissions based on file mode instead of deferring to adbfs")
+	flag.StringVar(&config.VolumeName, "volume-name", "", "volume name shown by the OS (e.g. in Finder/Nautilus)")
+	flag.StringVar(&config.FSName, "fs-name", "adbfs", "filesystem name shown by mount(8)/df(1)")
+	flag.StringVar(&config.Subtype, "subtype", "", "filesystem subtype shown by mount(8)/df(1)")
+	flag.IntVar(&config.MaxReadahead, "max-readahead", 0, "max readahead in bytes, 0 for the kernel default")
+	flag.BoolVar(&config.WritebackCache, "writeback-cache", false, "enable kernel writeback caching")
+	flag.BoolVar(&config.NoAppleDouble, "no-apple-double", false, "(macOS) refuse to create AppleDouble (._*) files")
+	flag.BoolVar(&config.NoAppleXattr, "no-apple-xattr", false, "(macOS) refuse com.apple.* extended attributes")
+}
+
+// ClientConfig returns the goadb.ClientConfig described by the parsed flags.
+func (c *AdbfsConfig) ClientConfig() goadb.ClientConfig {
+	return goadb.ClientConfig{
+		Port: c.AdbPort,
+	}
+}